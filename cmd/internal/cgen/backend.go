@@ -0,0 +1,51 @@
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package cgen
+
+import (
+	"bytes"
+
+	a "github.com/google/puffs/lang/ast"
+	t "github.com/google/puffs/lang/token"
+)
+
+// Backend emits one target language's syntax for a parsed Puffs package.
+// Generator drives the walk (see ForEachStruct, ForEachFunc); a Backend
+// only has to say how to render the pieces that walk visits.
+//
+// EmitStatement and EmitExpr are exported so that a Backend can recurse
+// into itself (an if-statement's branches are statements; a binary op's
+// operands are exprs) without cgen needing to know anything about
+// per-language statement or expression syntax.
+type Backend interface {
+	// EmitPreamble writes whatever a generated file needs before any
+	// struct or func: license boilerplate, status codes, an include
+	// guard, a module declaration, and so on.
+	EmitPreamble(b *bytes.Buffer, pkgName string) error
+
+	EmitStruct(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Struct) error
+	EmitCtor(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Struct) error
+	EmitFunc(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Func) error
+	EmitStatement(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Node, depth uint32) error
+	EmitExpr(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Expr, depth uint32) error
+
+	// EmitHeaderEnd is called once, after the public struct, ctor and func
+	// declarations have been emitted. If done is true, Generate stops
+	// there: this is everything a standalone header needs (this is how
+	// cbackend implements its 'h' mode). Backends with no header/impl
+	// split, such as rustbackend and wasmbackend, always return false.
+	EmitHeaderEnd(b *bytes.Buffer, pkgName string) (done bool, err error)
+
+	// TypeName returns the target language's spelling of the Puffs type
+	// named by k, and whether k is convertible at all.
+	TypeName(m *t.IDMap, k t.Key) (string, bool)
+
+	// OpName returns the target language's spelling of the Puffs operator
+	// k (e.g. "+=", "&&").
+	OpName(k t.Key) string
+
+	// Format runs the target language's canonical formatter (if any) over
+	// the raw, generated source and returns the result.
+	Format(raw *bytes.Buffer) ([]byte, error)
+}
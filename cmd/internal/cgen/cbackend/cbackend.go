@@ -0,0 +1,945 @@
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+// Package cbackend is cgen's C Backend: the original, and so far only
+// complete, target of the Puffs compiler.
+package cbackend
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"os/exec"
+	"strings"
+
+	a "github.com/google/puffs/lang/ast"
+	t "github.com/google/puffs/lang/token"
+)
+
+// Backend emits C. It implements cgen.Backend.
+type Backend struct {
+	// HeaderOnly selects 'h'-file output (declarations only, no private
+	// structs or function bodies). When false, Generate produces a full
+	// '.c' file.
+	HeaderOnly bool
+
+	// includeGuard is set by EmitPreamble and consumed by EmitHeaderEnd.
+	includeGuard string
+
+	// abiVersion is a hash of every Suspendible struct's ordered field
+	// list, accumulated by noteAbiVersion as EmitStruct visits the
+	// package's public structs (which, per Generate's walk order, all run
+	// before the first EmitCtor or EmitFunc call). It names the
+	// internal-ABI symbol that a public, receiver-taking func's stable
+	// trampoline forwards to; see writeAbiTrampoline.
+	abiVersion uint32
+
+	// RetainedVersions lists prior abiVersion hashes (from a previous
+	// Generate run, over a previous version of the same Puffs package)
+	// whose internal-ABI symbol should keep resolving. For each one,
+	// writeAbiTrampoline emits an extra trampoline, guarded by a build
+	// tag naming that version, forwarding the old internal symbol to
+	// the current implementation.
+	//
+	// This is only a valid shim when every retained version's struct
+	// layout is a prefix of the current one (fields only ever appended,
+	// never reordered, resized or removed): forwarding to the current
+	// implementation assumes the current body can still satisfy an
+	// older caller's view of the struct. A layout change that isn't
+	// purely additive needs the old version's own implementation kept
+	// around, not just a trampoline to the new one -- RetainedVersions
+	// doesn't help there.
+	RetainedVersions []uint32
+
+	// abiVersionLocked is set by the first EmitCtor or EmitFunc call,
+	// both of which consume abiVersion. It makes noteAbiVersion ignore
+	// any EmitStruct call after that point: Generate's private-struct
+	// walk (PriOnly) runs after the first public EmitCtor/EmitFunc, and
+	// without this guard, a private Suspendible struct visited during
+	// that later walk would still be folded into abiVersion by
+	// noteAbiVersion (which has no way to tell a struct's visibility
+	// apart; see its own TODO), changing the value every public ctor
+	// after it in the same file would embed versus every one before it.
+	abiVersionLocked bool
+}
+
+// New returns a C Backend. Pass headerOnly true for a '.h' file, false for
+// a '.c' file.
+func New(headerOnly bool) *Backend {
+	return &Backend{HeaderOnly: headerOnly}
+}
+
+func (c *Backend) extension() byte {
+	if c.HeaderOnly {
+		return 'h'
+	}
+	return 'c'
+}
+
+func (c *Backend) EmitPreamble(b *bytes.Buffer, pkgName string) error {
+	c.includeGuard = "PUFFS_" + strings.ToUpper(pkgName) + "_H"
+	fmt.Fprintf(b, "#ifndef %s\n#define %s\n\n", c.includeGuard, c.includeGuard)
+
+	fmt.Fprintf(b, "// Code generated by puffs-gen-%c. DO NOT EDIT.\n\n", c.extension())
+	b.WriteString(preamble)
+	b.WriteString("\n#ifdef __cplusplus\nextern \"C\" {\n#endif\n\n")
+
+	b.WriteString("// ---------------- Status Codes\n\n")
+	b.WriteString("// Status codes are non-positive integers.\n")
+	b.WriteString("//\n")
+	b.WriteString("// The least significant bit indicates a non-recoverable status code: an error.\n")
+	b.WriteString("typedef enum {\n")
+	fmt.Fprintf(b, "puffs_%s_status_ok = 0,\n", pkgName)
+	fmt.Fprintf(b, "puffs_%s_error_bad_version = -2 + 1,\n", pkgName)
+	fmt.Fprintf(b, "puffs_%s_error_null_receiver = -4 + 1,\n", pkgName)
+	fmt.Fprintf(b, "puffs_%s_error_constructor_not_called= -6 + 1,\n", pkgName)
+	fmt.Fprintf(b, "puffs_%s_status_short_dst = -8,\n", pkgName)
+	fmt.Fprintf(b, "puffs_%s_status_short_src = -10,\n", pkgName)
+	fmt.Fprintf(b, "} puffs_%s_status;\n\n", pkgName)
+
+	b.WriteString("// ---------------- Structs\n\n")
+	return nil
+}
+
+func (c *Backend) EmitHeaderEnd(b *bytes.Buffer, pkgName string) (bool, error) {
+	b.WriteString("\n#ifdef __cplusplus\n}  // extern \"C\"\n#endif\n\n")
+	fmt.Fprintf(b, "#endif  // %s\n\n", c.includeGuard)
+	if c.HeaderOnly {
+		return true, nil
+	}
+
+	b.WriteString("// PUFFS_MAGIC is a magic number to check that constructors are called. It's\n")
+	b.WriteString("// not foolproof, given C doesn't automatically zero memory before use, but it\n")
+	b.WriteString("// should catch 99.99% of cases.\n")
+	b.WriteString("//\n")
+	b.WriteString("// Its (non-zero) value is arbitrary, based on md5sum(\"puffs\").\n")
+	b.WriteString("#define PUFFS_MAGIC (0xCB3699CCU)\n\n")
+	b.WriteString("// PUFFS_ALREADY_ZEROED is passed from a container struct's constructor to a\n")
+	b.WriteString("// containee struct's constructor when the container has already zeroed the\n")
+	b.WriteString("// containee's memory.\n")
+	b.WriteString("//\n")
+	b.WriteString("// Its (non-zero) value is arbitrary, based on md5sum(\"zeroed\").\n")
+	b.WriteString("#define PUFFS_ALREADY_ZEROED (0x68602EF1U)\n\n")
+	return false, nil
+}
+
+// noteAbiVersion folds n's ordered field list into c's running ABI
+// version: a hash of every reachable public struct's field names and
+// types, used to name the internal-ABI symbol a public func's stable
+// trampoline forwards to (see writeAbiTrampoline). Adding, removing or
+// reordering a field changes the hash, and so the internal symbol name,
+// without moving the trampoline that old callers linked against.
+//
+// TODO: gate this on n being public and walk reachability from the
+// package's public funcs, rather than using Suspendible as a stand-in for
+// "has a receiver-taking public API"; a.Struct has no Public() accessor
+// yet to check the former, and reachability analysis doesn't exist yet
+// for the latter.
+func (c *Backend) noteAbiVersion(m *t.IDMap, n *a.Struct) {
+	if c.abiVersionLocked {
+		return
+	}
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s:", n.Name().String(m))
+	for _, f := range n.Fields() {
+		f := f.Field()
+		fmt.Fprintf(h, "%s %s;", f.Name().String(m), f.XType().String(m))
+	}
+	c.abiVersion ^= h.Sum32()
+}
+
+func (c *Backend) EmitStruct(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Struct) error {
+	structName := n.Name().String(m)
+	fmt.Fprintf(b, "typedef struct {\n")
+	if n.Suspendible() {
+		c.noteAbiVersion(m, n)
+
+		fmt.Fprintf(b, "puffs_%s_status status;\n", pkgName)
+		fmt.Fprintf(b, "uint32_t magic;\n")
+
+		// abi_version records the internal-ABI version this instance was
+		// constructed against, alongside magic. It's for diagnostics (a
+		// debugger or crash handler can tell which ABI produced a given
+		// struct); puffs_%s_%s__vN in the symbol name is what actually
+		// selects which internal implementation a call dispatches to.
+		fmt.Fprintf(b, "uint32_t abi_version;\n")
+
+		// coro_state is meant to hold the resume label for a func that
+		// returned status_short_dst or status_short_src and is later
+		// re-entered; see the matching note on EmitFunc's cs and on
+		// writeStatement's KWhile case. It's reserved here, but nothing
+		// yet writes it or dispatches on it, so it never holds anything
+		// but its zero-initialized value.
+		//
+		// TODO: also reserve per-func live-variable slots here, once
+		// EmitStatement's live-variable analysis knows which locals of a
+		// suspendible func are live across a yield point.
+		fmt.Fprintf(b, "uint32_t coro_state;\n")
+	}
+	for _, f := range n.Fields() {
+		if err := c.writeField(b, m, f.Field()); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(b, "} puffs_%s_%s;\n\n", pkgName, structName)
+	return nil
+}
+
+func (c *Backend) writeCtorSignature(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Struct, ctor bool) {
+	structName := n.Name().String(m)
+	ctorName := "destructor"
+	if ctor {
+		ctorName = "constructor"
+		fmt.Fprintf(b, "// puffs_%s_%s_%s is a constructor function.\n", pkgName, structName, ctorName)
+		fmt.Fprintf(b, "//\n")
+		fmt.Fprintf(b, "// It should be called before any other puffs_%s_%s_* function.\n",
+			pkgName, structName)
+		fmt.Fprintf(b, "//\n")
+		fmt.Fprintf(b, "// Pass PUFFS_VERSION and 0 for puffs_version and for_internal_use_only.\n")
+	}
+	fmt.Fprintf(b, "void puffs_%s_%s_%s(puffs_%s_%s *self", pkgName, structName, ctorName, pkgName, structName)
+	if ctor {
+		fmt.Fprintf(b, ", uint32_t puffs_version, uint32_t for_internal_use_only")
+	}
+	fmt.Fprintf(b, ")")
+}
+
+func (c *Backend) EmitCtor(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Struct) error {
+	// Every ctor and func in this file must embed or name the same
+	// abiVersion; see the field's own doc comment.
+	c.abiVersionLocked = true
+	if !n.Suspendible() {
+		return nil
+	}
+	for _, ctor := range []bool{true, false} {
+		c.writeCtorSignature(b, pkgName, m, n, ctor)
+		if c.HeaderOnly {
+			b.WriteString(";\n\n")
+			continue
+		}
+
+		fmt.Fprintf(b, "{\n")
+		fmt.Fprintf(b, "if (!self) { return; }\n")
+
+		if ctor {
+			fmt.Fprintf(b, "if (puffs_version != PUFFS_VERSION) {\n")
+			fmt.Fprintf(b, "self->status = puffs_%s_error_bad_version;\n", pkgName)
+			fmt.Fprintf(b, "return;\n")
+			fmt.Fprintf(b, "}\n")
+
+			b.WriteString("if (for_internal_use_only != PUFFS_ALREADY_ZEROED) {" +
+				"memset(self, 0, sizeof(*self)); }\n")
+			b.WriteString("self->magic = PUFFS_MAGIC;\n")
+			fmt.Fprintf(b, "self->abi_version = %dU;\n", c.abiVersion)
+
+			for _, f := range n.Fields() {
+				f := f.Field()
+				if dv := f.DefaultValue(); dv != nil {
+					// TODO: set default values for array types.
+					fmt.Fprintf(b, "self->f_%s = %d;\n", f.Name().String(m), dv.ConstValue())
+				}
+			}
+		}
+
+		// TODO: call any ctor/dtors on sub-structures.
+		b.WriteString("}\n\n")
+	}
+	return nil
+}
+
+// abiWrapped reports whether n gets a versioned internal-ABI symbol plus a
+// stable public trampoline (see writeAbiTrampoline), rather than a single
+// symbol under its plain name. Only a public func with a receiver takes a
+// struct pointer whose layout can change between ABI versions; a
+// freestanding func has nothing to version against.
+func (c *Backend) abiWrapped(n *a.Func) bool {
+	return n.Public() && n.Receiver() != 0
+}
+
+// funcSymbol returns n's linker symbol name: the stable, public name
+// (e.g. puffs_pkg_struct_method) if internal is false, or the
+// currently-versioned internal-ABI name (puffs_pkg_struct_method__vN) if
+// internal is true and n is abiWrapped. Callers always use the stable
+// name; only the trampoline and the definition it forwards to use the
+// internal one.
+func (c *Backend) funcSymbol(pkgName string, m *t.IDMap, n *a.Func, internal bool) string {
+	s := fmt.Sprintf("puffs_%s", pkgName)
+	if r := n.Receiver(); r != 0 {
+		s += "_" + r.String(m)
+	}
+	s += "_" + n.Name().String(m)
+	if internal && c.abiWrapped(n) {
+		s += fmt.Sprintf("__v%d", c.abiVersion)
+	}
+	return s
+}
+
+// isDecodeEntryPoint reports whether n is a package's public, suspendible,
+// receiver func: a decode entry point, in fuzzbackend's terms. Such a func
+// takes its unconsumed source bytes as a (src_ptr, src_len) pair, the same
+// convention requested of wasmbackend's slice args, rather than a
+// Puffs-level slice type this backend has no way to convert yet.
+func isDecodeEntryPoint(n *a.Func) bool {
+	return n.Public() && n.Suspendible() && n.Receiver() != 0
+}
+
+func (c *Backend) writeFuncSignature(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Func, symbol string) {
+	if n.Suspendible() {
+		fmt.Fprintf(b, "puffs_%s_status", pkgName)
+	} else {
+		fmt.Fprintf(b, "void")
+	}
+	fmt.Fprintf(b, " %s(", symbol)
+	if r := n.Receiver(); r != 0 {
+		fmt.Fprintf(b, "puffs_%s_%s *self", pkgName, r.String(m))
+	}
+	if isDecodeEntryPoint(n) {
+		fmt.Fprintf(b, ", const uint8_t *src_ptr, size_t src_len")
+	}
+	// TODO: write n's other args, if it has any beyond the source bytes
+	// above.
+	fmt.Fprintf(b, ")")
+}
+
+// writeAbiTrampoline emits the stable, public symbol for an abiWrapped n.
+// It does nothing but forward to the current internal-ABI symbol. When a
+// public struct's fields change, abiVersion changes, the internal symbol
+// a newly-compiled trampoline forwards to changes with it, but the
+// trampoline's own name and signature never move — so a binary compiled
+// against an older internal symbol keeps working as long as a trampoline
+// forwarding to *that* symbol is still linked in (e.g. an older version of
+// this generated file, kept behind a build tag).
+//
+// TODO: once func args beyond a decode entry point's src_ptr/src_len are
+// generated (writeFuncSignature's "TODO: write n's other args"), forward
+// them here too.
+func (c *Backend) writeAbiTrampoline(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Func) {
+	c.writeFuncSignature(b, pkgName, m, n, c.funcSymbol(pkgName, m, n, false))
+	b.WriteString("{\n")
+	if n.Suspendible() {
+		b.WriteString("return ")
+	}
+	args := "self"
+	if isDecodeEntryPoint(n) {
+		args += ", src_ptr, src_len"
+	}
+	fmt.Fprintf(b, "%s(%s);\n", c.funcSymbol(pkgName, m, n, true), args)
+	b.WriteString("}\n\n")
+
+	receiver := ""
+	if r := n.Receiver(); r != 0 {
+		receiver = r.String(m)
+	}
+	for _, v := range c.RetainedVersions {
+		b.WriteString(retainedTrampolineSrc(pkgName, receiver, n.Name().String(m), n.Suspendible(), v))
+	}
+}
+
+// retainedTrampolineSrc returns a build-tag-guarded trampoline forwarding
+// oldVersion's internal-ABI symbol (c.funcSymbol's "__vN" suffix, here
+// computed directly from oldVersion rather than through a *a.Func, so this
+// is callable, and testable, without one) to the current stable public
+// symbol, which writeAbiTrampoline in turn forwards to the current
+// internal-ABI symbol. See RetainedVersions for when this shim is actually
+// valid.
+//
+// The guard is left to the caller to define (e.g. a compatibility
+// umbrella header enabling PUFFS_RETAIN_ABI_vN for whichever old
+// versions it still supports, conditioned on its own build tags), since
+// cgen has no way to know which old versions a given build wants to
+// keep; PUFFS_RETAIN_ABI_vN just has to be defined before this file is
+// compiled.
+func retainedTrampolineSrc(pkgName, receiver, name string, suspendible bool, oldVersion uint32) string {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "#if defined(PUFFS_RETAIN_ABI_v%d)\n", oldVersion)
+
+	returnType, ret := "void", ""
+	if suspendible {
+		returnType, ret = fmt.Sprintf("puffs_%s_status", pkgName), "return "
+	}
+	oldSymbol := fmt.Sprintf("puffs_%s", pkgName)
+	newSymbol := oldSymbol
+	if receiver != "" {
+		oldSymbol += "_" + receiver
+		newSymbol += "_" + receiver
+	}
+	oldSymbol += "_" + name + fmt.Sprintf("__v%d", oldVersion)
+	newSymbol += "_" + name
+
+	// Here, as in writeAbiTrampoline, suspendible implies this is a decode
+	// entry point: retainedTrampolineSrc is only ever called for an
+	// abiWrapped n (Public() && Receiver() != 0), so suspendible is the
+	// one remaining isDecodeEntryPoint condition left to check.
+	extraParams, extraArgs := "", ""
+	if suspendible {
+		extraParams = ", const uint8_t *src_ptr, size_t src_len"
+		extraArgs = ", src_ptr, src_len"
+	}
+	fmt.Fprintf(b, "%s %s(puffs_%s_%s *self%s) {\n", returnType, oldSymbol, pkgName, receiver, extraParams)
+	fmt.Fprintf(b, "%s%s(self%s);\n", ret, newSymbol, extraArgs)
+	b.WriteString("}\n#endif\n\n")
+	return b.String()
+}
+
+func (c *Backend) EmitFunc(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Func) error {
+	// Every ctor and func in this file must embed or name the same
+	// abiVersion; see the field's own doc comment.
+	c.abiVersionLocked = true
+	wrapped := c.abiWrapped(n)
+	if c.HeaderOnly {
+		// The header only ever declares the stable name: the internal-ABI
+		// symbol is private to whichever .c file currently defines it.
+		c.writeFuncSignature(b, pkgName, m, n, c.funcSymbol(pkgName, m, n, false))
+		b.WriteString(";\n\n")
+		return nil
+	}
+	c.writeFuncSignature(b, pkgName, m, n, c.funcSymbol(pkgName, m, n, wrapped))
+	b.WriteString("{\n")
+
+	cleanup0 := false
+
+	// Check the previous status and the args.
+	if n.Public() {
+		if n.Receiver() != 0 {
+			fmt.Fprintf(b, "if (!self) { return puffs_%s_error_null_receiver; }\n", pkgName)
+		}
+	}
+	if n.Suspendible() {
+		fmt.Fprintf(b, "puffs_%s_status status = ", pkgName)
+		if n.Receiver() != 0 {
+			fmt.Fprintf(b, "self->status;\n")
+			if n.Public() {
+				fmt.Fprintf(b, "if (status & 1) { return status; }")
+			}
+		} else {
+			fmt.Fprintf(b, "puffs_%s_status_ok;\n", pkgName)
+		}
+		if n.Public() {
+			fmt.Fprintf(b, "if (self->magic != PUFFS_MAGIC) {"+
+				"status = puffs_%s_error_constructor_not_called; goto cleanup0; }\n", pkgName)
+			cleanup0 = true
+		}
+	} else if r := n.Receiver(); r != 0 {
+		// TODO: fix this.
+		return fmt.Errorf(`cannot convert Puffs function "%s.%s" to C`, r.String(m), n.Name().String(m))
+	}
+	// TODO: check the args.
+	b.WriteString("\n")
+
+	// Generate the local variables.
+	if err := c.writeVars(b, pkgName, m, n.Node(), 0); err != nil {
+		return err
+	}
+	b.WriteString("\n")
+
+	// A suspendible func with a receiver could, in principle, be
+	// re-entered after returning a short_dst or short_src status: cs
+	// would dispatch on self->coro_state to resume at the label it
+	// suspended from, rather than re-running the func from the top.
+	//
+	// That isn't implemented yet: nothing sets self->coro_state to a
+	// yield point's label, or spills/restores the locals live across a
+	// yield, before a short-status return (both need KReturn, KJump and
+	// call codegen -- writeExprOther's KeyOpenParen case -- to know
+	// where a yield can occur and what's live across it; none of the
+	// three exist yet). Leave cs disabled, and the switch unemitted,
+	// rather than emit a switch (self->coro_state) { case 0: ... } that
+	// can only ever take case 0 and claim a coroutine lowering that
+	// doesn't function. See the matching note on KWhile in
+	// writeStatement, and allocLabel.
+	cs := &coroState{}
+
+	// Generate the function body.
+	for _, o := range n.Body() {
+		if err := c.writeStatement(b, pkgName, m, o, cs, 0); err != nil {
+			return err
+		}
+	}
+
+	if cs.enabled {
+		b.WriteString("}\n")
+	}
+	b.WriteString("\n")
+
+	if cleanup0 {
+		fmt.Fprintf(b, "cleanup0: self->status = status;\n")
+	}
+	if n.Suspendible() {
+		fmt.Fprintf(b, "return status;\n")
+	}
+
+	b.WriteString("}\n\n")
+
+	if wrapped {
+		c.writeAbiTrampoline(b, pkgName, m, n)
+	}
+	return nil
+}
+
+func (c *Backend) writeField(b *bytes.Buffer, m *t.IDMap, n *a.Field) error {
+	convertible := true
+	for x := n.XType(); x != nil; x = x.Inner() {
+		if p := x.PackageOrDecorator(); p != 0 && p != t.IDOpenBracket {
+			convertible = false
+			break
+		}
+		if x.Inner() != nil {
+			continue
+		}
+		if s, ok := c.TypeName(m, x.Name().Key()); ok {
+			b.WriteString(s)
+			b.WriteByte(' ')
+			continue
+		}
+		convertible = false
+		break
+	}
+	if !convertible {
+		// TODO: fix this.
+		return fmt.Errorf("cannot convert Puffs type %q to C", n.XType().String(m))
+	}
+
+	b.WriteString("f_")
+	b.WriteString(n.Name().String(m))
+
+	for x := n.XType(); x != nil; x = x.Inner() {
+		if x.PackageOrDecorator() == t.IDOpenBracket {
+			b.WriteByte('[')
+			b.WriteString(x.ArrayLength().ConstValue().String())
+			b.WriteByte(']')
+		}
+	}
+
+	b.WriteString(";\n")
+	return nil
+}
+
+func (c *Backend) writeVars(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Node, depth uint32) error {
+	if depth > a.MaxBodyDepth {
+		return fmt.Errorf("cbackend: body recursion depth too large")
+	}
+	depth++
+
+	if n.Kind() == a.KVar {
+		x := n.Var().XType()
+		if s, ok := c.TypeName(m, x.Name().Key()); ok {
+			fmt.Fprintf(b, "%s v_%s;\n", s, n.Var().Name().String(m))
+			return nil
+		}
+		// TODO: fix this.
+		return fmt.Errorf("cbackend: cannot convert Puffs type %q to C", x.String(m))
+	}
+
+	for _, l := range n.Raw().SubLists() {
+		for _, o := range l {
+			if err := c.writeVars(b, pkgName, m, o, depth); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// coroState tracks resume-label allocation while generating the body of a
+// single Suspendible func. Each potential yield point gets a distinct,
+// stable label so that a later call can goto straight back into it instead
+// of re-running the func from the top.
+//
+// TODO: allocate labels at call sites too, once function calls (the
+// KeyOpenParen case in writeExprOther) are generated, since most short_dst
+// and short_src statuses come from a callee, not from a while back-edge.
+type coroState struct {
+	enabled   bool
+	nextLabel uint32
+}
+
+// allocLabel reserves and returns the next yield point's resume label
+// for the func cs is generating for. Labels are distinct and start at 1:
+// label 0 is reserved for self->coro_state's zero-initialized, "not
+// suspended" value, so a fresh call's switch can never collide with a
+// real resume label.
+func (cs *coroState) allocLabel() uint32 {
+	cs.nextLabel++
+	return cs.nextLabel
+}
+
+// EmitStatement implements cgen.Backend. It's the entry point for a
+// statement outside of any coroState (e.g. one reached only via the
+// Backend interface rather than via EmitFunc); it threads a disabled
+// coroState through, so a statement reached this way is never treated as
+// a yield point. EmitFunc instead calls writeStatement directly with the
+// coroState for the func it's generating.
+func (c *Backend) EmitStatement(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Node, depth uint32) error {
+	return c.writeStatement(b, pkgName, m, n, &coroState{}, depth)
+}
+
+// assertHasSideEffects reports whether n, or any subexpression of n,
+// is a function call. It's used to reject an assert statement's
+// expression up front, before it's duplicated across the several
+// preprocessor branches in the KAssert case below.
+func assertHasSideEffects(n *a.Expr) bool {
+	switch n.ID0().Key() {
+	case t.KeyOpenParen:
+		// n is a function call: the side effect this check exists to
+		// catch.
+		return true
+
+	case t.KeyOpenBracket, t.KeyColon:
+		// n is an index or a slice. Its receiver (and, for a slice, its
+		// low/high bounds, both reached the same way as a binary op's
+		// operands below) can themselves contain a call, e.g. a[f()], so
+		// recurse into them the same way writeExprOther's KeyOpenBracket
+		// and KeyColon cases will once they're implemented.
+		if l := n.LHS().Expr(); l != nil && assertHasSideEffects(l) {
+			return true
+		}
+		if r := n.RHS().Expr(); r != nil && assertHasSideEffects(r) {
+			return true
+		}
+		return false
+	}
+
+	switch n.ID0().Flags() & (t.FlagsUnaryOp | t.FlagsBinaryOp | t.FlagsAssociativeOp) {
+	case t.FlagsUnaryOp, t.FlagsBinaryOp:
+		if l := n.LHS().Expr(); l != nil && assertHasSideEffects(l) {
+			return true
+		}
+		if r := n.RHS().Expr(); r != nil && assertHasSideEffects(r) {
+			return true
+		}
+	case t.FlagsAssociativeOp:
+		if l := n.LHS().Expr(); l != nil && assertHasSideEffects(l) {
+			return true
+		}
+		if r := n.RHS().Expr(); r != nil && assertHasSideEffects(r) {
+			return true
+		}
+		// TODO: an associative op's operands beyond the first two, if
+		// any (e.g. the c in a + b + c), aren't reachable via LHS/RHS
+		// the way writeExprAssociativeOp's own TODO implies; walk
+		// whatever holds them too, once writeExprAssociativeOp is
+		// implemented and that representation is visible here.
+	}
+	return false
+}
+
+func (c *Backend) writeStatement(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Node, cs *coroState, depth uint32) error {
+	if depth > a.MaxBodyDepth {
+		return fmt.Errorf("cbackend: body recursion depth too large")
+	}
+	depth++
+
+	switch n.Kind() {
+	case a.KAssert:
+		n := n.Assert()
+		cond := n.Condition()
+		if assertHasSideEffects(cond) {
+			// __builtin_assume, __assume and the GCC idiom below all let
+			// the compiler decide whether (and how many times) to
+			// evaluate cond; a call's side effects shouldn't be at the
+			// compiler's mercy like that.
+			return fmt.Errorf("cbackend: assert expression must not have side effects (call a func)")
+		}
+
+		condBuf := &bytes.Buffer{}
+		if err := c.EmitExpr(condBuf, pkgName, m, cond, depth); err != nil {
+			return err
+		}
+		condSrc := condBuf.String()
+		if condSrc == "" {
+			// cond's top node is a kind EmitExpr doesn't lower yet (a
+			// unary op, an associative op, or x as T all still write
+			// nothing), so there's no source to assert, assume or hint
+			// with. Emit nothing, as baseline did for every KAssert,
+			// rather than assert(), __builtin_assume() and friends with
+			// an empty argument list, which don't compile.
+			return nil
+		}
+
+		// The Puffs front end has already proven cond at compile time. At
+		// a debug build, also check it at runtime, in case the proof or
+		// this code generator is wrong. At an optimized build, hand cond
+		// to the C compiler as a fact instead: it can then drop redundant
+		// bounds checks in the surrounding index and slice arithmetic
+		// (writeExprOther's KeyOpenBracket and KeyColon cases) the same
+		// way it would after a hand-written assumption.
+		b.WriteString("#if defined(PUFFS_DEBUG)\n")
+		fmt.Fprintf(b, "assert(%s);\n", condSrc)
+		b.WriteString("#elif defined(__clang__)\n")
+		fmt.Fprintf(b, "__builtin_assume(%s);\n", condSrc)
+		b.WriteString("#elif defined(__GNUC__)\n")
+		fmt.Fprintf(b, "if (!(%s)) { __builtin_unreachable(); }\n", condSrc)
+		b.WriteString("#elif defined(_MSC_VER)\n")
+		fmt.Fprintf(b, "__assume(%s);\n", condSrc)
+		b.WriteString("#endif\n")
+		return nil
+
+	case a.KAssign:
+		n := n.Assign()
+		if err := c.EmitExpr(b, pkgName, m, n.LHS(), depth); err != nil {
+			return err
+		}
+		// TODO: does KeyAmpHatEq need special consideration?
+		b.WriteString(c.OpName(0xFF & n.Operator().Key()))
+		if err := c.EmitExpr(b, pkgName, m, n.RHS(), depth); err != nil {
+			return err
+		}
+		b.WriteString(";\n")
+		return nil
+
+	case a.KIf:
+		// TODO.
+
+	case a.KJump:
+		// TODO.
+
+	case a.KReturn:
+		// TODO.
+
+	case a.KVar:
+		n := n.Var()
+		fmt.Fprintf(b, "v_%s = ", n.Name().String(m))
+		if v := n.Value(); v != nil {
+			if err := c.EmitExpr(b, pkgName, m, v, 0); err != nil {
+				return err
+			}
+		} else {
+			b.WriteByte('0')
+		}
+		b.WriteString(";\n")
+		return nil
+
+	case a.KWhile:
+		n := n.While()
+		// A while loop's back-edge can observe a short_dst or short_src
+		// status from its condition or body, so it's a yield point, and
+		// would need a resume label: switch (self->coro_state) could
+		// then jump straight past the condition check when resuming
+		// (the condition was already true the last time this label was
+		// about to run), while a fresh call (coro_state == 0) falls
+		// through from above and evaluates the condition like any other
+		// while loop. That label would have to sit on the loop's first
+		// statement, physically inside the body, rather than on the
+		// while statement itself: a label placed before the while would
+		// sit on case 0's fallthrough path too, so every call, fresh or
+		// resumed, would jump straight into the body and skip the
+		// condition check.
+		//
+		// cs.enabled is always false today (see EmitFunc), so none of
+		// this actually runs: nothing sets self->coro_state to a label
+		// or spills/restores the locals live across this loop before a
+		// short-status return, both of which need KReturn, KJump (still
+		// TODO below) and call codegen (writeExprOther's KeyOpenParen
+		// case, also still TODO). The cs.enabled checks below are kept
+		// so that turning it on is the only change needed once those
+		// exist, rather than rewriting this case from scratch.
+		label := uint32(0)
+		if cs.enabled {
+			label = cs.allocLabel()
+		}
+		b.WriteString("while (")
+		if err := c.EmitExpr(b, pkgName, m, n.Condition(), 0); err != nil {
+			return err
+		}
+		b.WriteString(") {\n")
+		if cs.enabled {
+			fmt.Fprintf(b, "case %d:;\n", label)
+		}
+		for _, o := range n.Body() {
+			if err := c.writeStatement(b, pkgName, m, o, cs, depth); err != nil {
+				return err
+			}
+		}
+		b.WriteString("}\n")
+		return nil
+	}
+	return fmt.Errorf("cbackend: unrecognized ast.Kind (%s) for EmitStatement", n.Kind())
+}
+
+func (c *Backend) EmitExpr(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Expr, depth uint32) error {
+	if depth > a.MaxExprDepth {
+		return fmt.Errorf("cbackend: expression recursion depth too large")
+	}
+	depth++
+
+	if cv := n.ConstValue(); cv != nil {
+		// TODO: write false/true instead of 0/1 if n.MType() is bool?
+		b.WriteString(cv.String())
+		return nil
+	}
+
+	switch n.ID0().Flags() & (t.FlagsUnaryOp | t.FlagsBinaryOp | t.FlagsAssociativeOp) {
+	case 0:
+		if err := c.writeExprOther(b, pkgName, m, n, depth); err != nil {
+			return err
+		}
+	case t.FlagsUnaryOp:
+		if err := c.writeExprUnaryOp(b, pkgName, m, n, depth); err != nil {
+			return err
+		}
+	case t.FlagsBinaryOp:
+		if err := c.writeExprBinaryOp(b, pkgName, m, n, depth); err != nil {
+			return err
+		}
+	case t.FlagsAssociativeOp:
+		if err := c.writeExprAssociativeOp(b, pkgName, m, n, depth); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("cbackend: unrecognized token.Key (0x%X) for EmitExpr", n.ID0().Key())
+	}
+
+	return nil
+}
+
+func (c *Backend) writeExprOther(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Expr, depth uint32) error {
+	switch n.ID0().Key() {
+	case 0:
+		if id1 := n.ID1(); id1.Key() == t.KeyThis {
+			b.WriteString("self")
+		} else {
+			// TODO: don't assume that the v_ prefix is necessary.
+			b.WriteString("v_")
+			b.WriteString(id1.String(m))
+		}
+		return nil
+
+	case t.KeyOpenParen:
+	// n is a function call.
+	// TODO.
+
+	case t.KeyOpenBracket:
+	// n is an index.
+	// TODO.
+
+	case t.KeyColon:
+	// n is a slice.
+	// TODO.
+
+	case t.KeyDot:
+		if err := c.EmitExpr(b, pkgName, m, n.LHS().Expr(), depth); err != nil {
+			return err
+		}
+		// TODO: choose between . vs -> operators.
+		//
+		// TODO: don't assume that the f_ prefix is necessary.
+		b.WriteString("->f_")
+		b.WriteString(n.ID1().String(m))
+		return nil
+	}
+	return fmt.Errorf("cbackend: unrecognized token.Key (0x%X) for writeExprOther", n.ID0().Key())
+}
+
+func (c *Backend) writeExprUnaryOp(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Expr, depth uint32) error {
+	// TODO.
+	return nil
+}
+
+func (c *Backend) writeExprBinaryOp(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Expr, depth uint32) error {
+	op := n.ID0()
+	if op.Key() == t.KeyXBinaryAs {
+		// TODO.
+		return nil
+	}
+	b.WriteByte('(')
+	if err := c.EmitExpr(b, pkgName, m, n.LHS().Expr(), depth); err != nil {
+		return err
+	}
+	// TODO: does KeyXBinaryAmpHat need special consideration?
+	b.WriteString(c.OpName(0xFF & op.Key()))
+	if err := c.EmitExpr(b, pkgName, m, n.RHS().Expr(), depth); err != nil {
+		return err
+	}
+	b.WriteByte(')')
+	return nil
+}
+
+func (c *Backend) writeExprAssociativeOp(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Expr, depth uint32) error {
+	// TODO.
+	return nil
+}
+
+func (c *Backend) TypeName(m *t.IDMap, k t.Key) (string, bool) {
+	if k < t.Key(len(cTypeNames)) {
+		if s := cTypeNames[k]; s != "" {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+func (c *Backend) OpName(k t.Key) string {
+	return cOpNames[0xFF&k]
+}
+
+func (c *Backend) Format(rawSource *bytes.Buffer) ([]byte, error) {
+	stdout := &bytes.Buffer{}
+	cmd := exec.Command("clang-format", "-style=Chromium")
+	cmd.Stdin = rawSource
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+var cTypeNames = [...]string{
+	t.KeyI8:    "int8_t",
+	t.KeyI16:   "int16_t",
+	t.KeyI32:   "int32_t",
+	t.KeyI64:   "int64_t",
+	t.KeyU8:    "uint8_t",
+	t.KeyU16:   "uint16_t",
+	t.KeyU32:   "uint32_t",
+	t.KeyU64:   "uint64_t",
+	t.KeyUsize: "size_t",
+	t.KeyBool:  "bool",
+}
+
+var cOpNames = [256]string{
+	t.KeyEq:       " = ",
+	t.KeyPlusEq:   " += ",
+	t.KeyMinusEq:  " -= ",
+	t.KeyStarEq:   " *= ",
+	t.KeySlashEq:  " /= ",
+	t.KeyShiftLEq: " <<= ",
+	t.KeyShiftREq: " >>= ",
+	t.KeyAmpEq:    " &= ",
+	t.KeyAmpHatEq: " no_such_amp_hat_C_operator ",
+	t.KeyPipeEq:   " |= ",
+	t.KeyHatEq:    " ^= ",
+
+	t.KeyXUnaryPlus:  "+",
+	t.KeyXUnaryMinus: "-",
+	t.KeyXUnaryNot:   "!",
+
+	t.KeyXBinaryPlus:        " + ",
+	t.KeyXBinaryMinus:       " - ",
+	t.KeyXBinaryStar:        " * ",
+	t.KeyXBinarySlash:       " / ",
+	t.KeyXBinaryShiftL:      " << ",
+	t.KeyXBinaryShiftR:      " >> ",
+	t.KeyXBinaryAmp:         " & ",
+	t.KeyXBinaryAmpHat:      " no_such_amp_hat_C_operator ",
+	t.KeyXBinaryPipe:        " | ",
+	t.KeyXBinaryHat:         " ^ ",
+	t.KeyXBinaryNotEq:       " != ",
+	t.KeyXBinaryLessThan:    " < ",
+	t.KeyXBinaryLessEq:      " <= ",
+	t.KeyXBinaryEqEq:        " == ",
+	t.KeyXBinaryGreaterEq:   " >= ",
+	t.KeyXBinaryGreaterThan: " > ",
+	t.KeyXBinaryAnd:         " && ",
+	t.KeyXBinaryOr:          " || ",
+	t.KeyXBinaryAs:          " no_such_as_C_operator ",
+
+	t.KeyXAssociativePlus: " + ",
+	t.KeyXAssociativeStar: " * ",
+	t.KeyXAssociativeAmp:  " & ",
+	t.KeyXAssociativePipe: " | ",
+	t.KeyXAssociativeHat:  " ^ ",
+	t.KeyXAssociativeAnd:  " && ",
+	t.KeyXAssociativeOr:   " || ",
+}
@@ -0,0 +1,252 @@
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+// Package fuzzbackend is cgen's fuzz-target Backend. For the package's
+// public, suspendible, receiver funcs (its decode entry points) it emits
+// an LLVMFuzzerTestOneInput-compatible C harness, turning the generated
+// codec into a self-contained OSS-Fuzz target without a hand-written
+// harness. GenerateGoTest emits the companion Go test that differentially
+// checks the same inputs decoded one-shot against decoded in arbitrary
+// chunks.
+package fuzzbackend
+
+import (
+	"bytes"
+	"fmt"
+
+	a "github.com/google/puffs/lang/ast"
+	t "github.com/google/puffs/lang/token"
+)
+
+// Backend emits a C fuzz harness. It implements cgen.Backend. Like
+// rustbackend and wasmbackend, it has no header/impl split.
+type Backend struct {
+	// Target, if non-empty, selects which public suspendible entry point
+	// (as "Receiver.Name", matching a Targets() entry) EmitHeaderEnd
+	// wires up LLVMFuzzerTestOneInput for. A single generated C file can
+	// only define one LLVMFuzzerTestOneInput, so fuzzing a package with
+	// more than one entry point means calling Generate once per target,
+	// each with a different Target set, rather than listing every target
+	// in one shared file.
+	//
+	// Left empty, EmitHeaderEnd wires up the package's first public
+	// suspendible entry point in ForEachFunc order.
+	Target string
+
+	targets []fuzzTarget
+}
+
+type fuzzTarget struct {
+	receiver string
+	name     string
+}
+
+// New returns a fuzz-harness Backend. Pass target as "Receiver.Name" to
+// select which public suspendible entry point to fuzz, or "" for the
+// package's first one; see Backend.Target.
+func New(target string) *Backend {
+	return &Backend{Target: target}
+}
+
+func (f *Backend) EmitPreamble(b *bytes.Buffer, pkgName string) error {
+	fmt.Fprintf(b, "// Code generated by puffs-gen-fuzz. DO NOT EDIT.\n\n")
+	b.WriteString("#include <stddef.h>\n#include <stdint.h>\n\n")
+	fmt.Fprintf(b, "#include \"puffs_%s.c\"\n\n", pkgName)
+	return nil
+}
+
+func (f *Backend) EmitStruct(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Struct) error {
+	return nil
+}
+
+func (f *Backend) EmitCtor(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Struct) error {
+	return nil
+}
+
+func (f *Backend) EmitFunc(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Func) error {
+	if !n.Public() || !n.Suspendible() || n.Receiver() == 0 {
+		return nil
+	}
+	f.targets = append(f.targets, fuzzTarget{
+		receiver: n.Receiver().String(m),
+		name:     n.Name().String(m),
+	})
+	return nil
+}
+
+func (f *Backend) EmitStatement(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Node, depth uint32) error {
+	return fmt.Errorf("fuzzbackend: no statement output; a harness calls into the already-generated C, it doesn't regenerate func bodies")
+}
+
+func (f *Backend) EmitExpr(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Expr, depth uint32) error {
+	return fmt.Errorf("fuzzbackend: no expr output; a harness calls into the already-generated C, it doesn't regenerate func bodies")
+}
+
+// EmitHeaderEnd writes LLVMFuzzerTestOneInput once every public,
+// suspendible entry point has been collected by EmitFunc. It wires up
+// whichever one f.Target names, or the first one found if f.Target is
+// empty; call Generate once per desired target (each with a different
+// f.Target) to fuzz every entry point in a package that has more than
+// one, rather than expecting a single generated file to cover all of
+// them.
+func (f *Backend) EmitHeaderEnd(b *bytes.Buffer, pkgName string) (bool, error) {
+	if len(f.targets) == 0 {
+		return false, fmt.Errorf("fuzzbackend: package %q has no public suspendible entry point to fuzz", pkgName)
+	}
+	target := f.targets[0]
+	if f.Target != "" {
+		found := false
+		for _, cand := range f.targets {
+			if cand.receiver+"."+cand.name == f.Target {
+				target, found = cand, true
+				break
+			}
+		}
+		if !found {
+			return false, fmt.Errorf("fuzzbackend: package %q has no public suspendible entry point named %q", pkgName, f.Target)
+		}
+	}
+
+	b.WriteString("// LLVMFuzzerTestOneInput feeds data to the decoder in a series of\n")
+	b.WriteString("// arbitrarily small chunks, using data[0] as the chunk-size schedule, so\n")
+	b.WriteString("// that a corpus entry calls the decoder again after every partial\n")
+	b.WriteString("// chunk instead of making a single one-shot call.\n")
+	b.WriteString("int LLVMFuzzerTestOneInput(const uint8_t *data, size_t size) {\n")
+	b.WriteString("if (size < 1) { return 0; }\n")
+	b.WriteString("size_t chunk_size = 1 + (data[0] % 16);\n")
+	b.WriteString("data++;\nsize--;\n\n")
+	fmt.Fprintf(b, "puffs_%s_%s self;\n", pkgName, target.receiver)
+	fmt.Fprintf(b, "puffs_%s_%s_constructor(&self, PUFFS_VERSION, 0);\n\n", pkgName, target.receiver)
+	b.WriteString("for (size_t i = 0; i < size; i += chunk_size) {\n")
+	b.WriteString("size_t n = chunk_size < size - i ? chunk_size : size - i;\n")
+	fmt.Fprintf(b, "puffs_%s_status status = puffs_%s_%s_%s(&self, data + i, n);\n",
+		pkgName, pkgName, target.receiver, target.name)
+	b.WriteString("if (status < 0 && (status & 1)) { break; }\n")
+	b.WriteString("}\n\n")
+	fmt.Fprintf(b, "puffs_%s_%s_destructor(&self);\n", pkgName, target.receiver)
+	b.WriteString("return 0;\n}\n")
+	return false, nil
+}
+
+func (f *Backend) TypeName(m *t.IDMap, k t.Key) (string, bool) {
+	return "", false
+}
+
+func (f *Backend) OpName(k t.Key) string {
+	return ""
+}
+
+func (f *Backend) Format(rawSource *bytes.Buffer) ([]byte, error) {
+	// TODO: shell out to clang-format, as cbackend does.
+	return rawSource.Bytes(), nil
+}
+
+// Targets returns the public suspendible entry points this Backend found,
+// as "Receiver.Name" strings in ForEachFunc order. GenerateGoTest needs
+// this list, but it isn't itself part of cgen.Backend: the companion Go
+// test isn't produced by a second walk of the Puffs AST, it's produced
+// once, from the same target list EmitFunc already collected for the C
+// harness above.
+func (f *Backend) Targets() []string {
+	names := make([]string, len(f.targets))
+	for i, target := range f.targets {
+		names[i] = target.receiver + "." + target.name
+	}
+	return names
+}
+
+// GenerateGoTest returns a Go test file that, for each target (as
+// returned by Backend.Targets), cgo-calls the generated C decoder twice
+// on the same quick.Check-generated input — once in one shot, once split
+// into arbitrary chunks the same way LLVMFuzzerTestOneInput does — and
+// checks that the two runs see the same sequence of status codes. A
+// decoder whose coro_state suspend/resume path is implemented correctly
+// must be indifferent to how its input is chunked; this catches one that
+// isn't.
+//
+// TODO: this only compares the generated C decoder against itself, not
+// against an independent reference decoder, as the request asks: the
+// repo doesn't have one yet to diff against. It also only compares status
+// codes, not output bytes, since decode entry points don't take a
+// destination arg yet (writeFuncSignature's "TODO: write n's other
+// args").
+func GenerateGoTest(pkgName string, targets []string) []byte {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "// Code generated by puffs-gen-fuzz. DO NOT EDIT.\n\n")
+	fmt.Fprintf(b, "package %s_test\n\n", pkgName)
+	fmt.Fprintf(b, "/*\n#include \"puffs_%s.c\"\n*/\nimport \"C\"\n\n", pkgName)
+	b.WriteString("import (\n\t\"testing\"\n\t\"testing/quick\"\n\t\"unsafe\"\n)\n\n")
+	b.WriteString("// statusesEqual reports whether two status sequences, as returned by\n")
+	b.WriteString("// this file's decodeXxx helpers, are identical.\n")
+	fmt.Fprintf(b, "func statusesEqual(a, b []C.puffs_%s_status) bool {\n", pkgName)
+	b.WriteString("\tif len(a) != len(b) {\n\t\treturn false\n\t}\n")
+	b.WriteString("\tfor i := range a {\n\t\tif a[i] != b[i] {\n\t\t\treturn false\n\t\t}\n\t}\n")
+	b.WriteString("\treturn true\n}\n\n")
+
+	for _, target := range targets {
+		name := exportedName(target)
+		receiver, fn := splitTarget(target)
+
+		fmt.Fprintf(b, "// decode%s drives puffs_%s_%s_%s to completion, feeding data in\n", name, pkgName, receiver, fn)
+		b.WriteString("// chunks of at most chunkSize bytes, and returns the status code seen\n")
+		b.WriteString("// after every call, in order.\n")
+		fmt.Fprintf(b, "func decode%s(data []byte, chunkSize int) []C.puffs_%s_status {\n", name, pkgName)
+		fmt.Fprintf(b, "\tvar self C.puffs_%s_%s\n", pkgName, receiver)
+		fmt.Fprintf(b, "\tC.puffs_%s_%s_constructor(&self, C.PUFFS_VERSION, 0)\n", pkgName, receiver)
+		fmt.Fprintf(b, "\tdefer C.puffs_%s_%s_destructor(&self)\n\n", pkgName, receiver)
+		b.WriteString("\tif chunkSize <= 0 {\n\t\tchunkSize = 1\n\t}\n")
+		fmt.Fprintf(b, "\tvar statuses []C.puffs_%s_status\n", pkgName)
+		b.WriteString("\tfor i := 0; i < len(data); i += chunkSize {\n")
+		b.WriteString("\t\tn := chunkSize\n")
+		b.WriteString("\t\tif rest := len(data) - i; n > rest {\n\t\t\tn = rest\n\t\t}\n")
+		b.WriteString("\t\tstatus := C.")
+		fmt.Fprintf(b, "puffs_%s_%s_%s(&self, (*C.uint8_t)(unsafe.Pointer(&data[i])), C.size_t(n))\n", pkgName, receiver, fn)
+		b.WriteString("\t\tstatuses = append(statuses, status)\n")
+		b.WriteString("\t\tif status < 0 && status&1 != 0 {\n\t\t\tbreak\n\t\t}\n")
+		b.WriteString("\t}\n\treturn statuses\n}\n\n")
+
+		fmt.Fprintf(b, "// Test%sChunked checks that puffs_%s_%s_%s sees the same status codes\n", name, pkgName, receiver, fn)
+		b.WriteString("// whether its input arrives in one shot or split into arbitrary chunks.\n")
+		fmt.Fprintf(b, "func Test%sChunked(t *testing.T) {\n", name)
+		b.WriteString("\tf := func(data []byte, chunkSize uint8) bool {\n")
+		b.WriteString("\t\tif len(data) == 0 {\n\t\t\treturn true\n\t\t}\n")
+		fmt.Fprintf(b, "\t\toneShot := decode%s(data, len(data))\n", name)
+		fmt.Fprintf(b, "\t\tchunked := decode%s(data, 1+int(chunkSize%%16))\n", name)
+		b.WriteString("\t\treturn statusesEqual(oneShot, chunked)\n")
+		b.WriteString("\t}\n")
+		b.WriteString("\tif err := quick.Check(f, nil); err != nil {\n\t\tt.Error(err)\n\t}\n")
+		b.WriteString("}\n\n")
+	}
+	return b.Bytes()
+}
+
+// splitTarget splits a "Receiver.Name" target (see Backend.Targets) back
+// into its receiver and name.
+func splitTarget(target string) (receiver, name string) {
+	for i := 0; i < len(target); i++ {
+		if target[i] == '.' {
+			return target[:i], target[i+1:]
+		}
+	}
+	return "", target
+}
+
+// exportedName turns a "Receiver.Name" target into an exported Go
+// identifier, e.g. "decoder.decode" becomes "DecoderDecode".
+func exportedName(target string) string {
+	out := make([]byte, 0, len(target))
+	upperNext := true
+	for i := 0; i < len(target); i++ {
+		c := target[i]
+		if c == '.' || c == '_' {
+			upperNext = true
+			continue
+		}
+		if upperNext && c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upperNext = false
+		out = append(out, c)
+	}
+	return string(out)
+}
@@ -0,0 +1,191 @@
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+// Package wasmbackend is cgen's WebAssembly Backend, for embedding Puffs
+// codecs in browser contexts without reimplementing the Puffs language
+// front end. It emits WAT (the WebAssembly text format); `wat2wasm` turns
+// that into a .wasm binary.
+//
+// It is a first step: structs become offset comments into a single linear
+// memory (WAT has no struct type), and func bodies are not yet emitted
+// (see EmitFunc).
+package wasmbackend
+
+import (
+	"bytes"
+	"fmt"
+
+	a "github.com/google/puffs/lang/ast"
+	t "github.com/google/puffs/lang/token"
+)
+
+// Backend emits WAT. It implements cgen.Backend. Like rustbackend, it has
+// no header/impl split: EmitHeaderEnd always reports done == false.
+type Backend struct {
+	// offset is the next free byte offset into the module's single linear
+	// memory, used to lay out struct fields.
+	offset uint32
+}
+
+// New returns a WebAssembly Backend.
+func New() *Backend {
+	return &Backend{}
+}
+
+func (w *Backend) EmitPreamble(b *bytes.Buffer, pkgName string) error {
+	fmt.Fprintf(b, ";; Code generated by puffs-gen-wasm. DO NOT EDIT.\n\n")
+	fmt.Fprintf(b, "(module\n")
+	b.WriteString("  (memory (export \"memory\") 1)\n\n")
+	return nil
+}
+
+func (w *Backend) EmitStruct(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Struct) error {
+	structName := n.Name().String(m)
+	fmt.Fprintf(b, "  ;; puffs_%s_%s, starting at byte offset %d of linear memory.\n", pkgName, structName, w.offset)
+	if n.Suspendible() {
+		fmt.Fprintf(b, "  ;;   status: i32 @ %d\n", w.offset)
+		w.offset += 4
+		fmt.Fprintf(b, "  ;;   coro_state: i32 @ %d\n", w.offset)
+		w.offset += 4
+	}
+	for _, f := range n.Fields() {
+		if err := w.writeField(b, m, f.Field()); err != nil {
+			return err
+		}
+	}
+	b.WriteString("\n")
+	return nil
+}
+
+func (w *Backend) EmitCtor(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Struct) error {
+	if !n.Suspendible() {
+		return nil
+	}
+	// TODO: emit a $puffs_pkgName_structName_constructor func, once
+	// EmitFunc can generate bodies: a constructor is just a func that
+	// stores zeroes (and any field default values) into its struct's
+	// memory range.
+	return nil
+}
+
+func (w *Backend) EmitFunc(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Func) error {
+	// Every Puffs func becomes a Wasm func named after its C symbol, and a
+	// public one is also exported under that name. Only the receiver is
+	// written as a param; n's other args are not (see the TODO below).
+	// EmitStatement/EmitExpr cannot lower a body, so the body is a lone
+	// unreachable, which keeps the module valid.
+	symbol := "puffs_" + pkgName
+	if r := n.Receiver(); r != 0 {
+		symbol += "_" + r.String(m)
+	}
+	symbol += "_" + n.Name().String(m)
+	fmt.Fprintf(b, "  (func $%s", symbol)
+	if n.Public() {
+		fmt.Fprintf(b, " (export \"%s\")", symbol)
+	}
+	if n.Receiver() != 0 {
+		b.WriteString(" (param $self i32)")
+	}
+	// TODO: write n's args as (param $name i32 i32) slice pairs.
+	if n.Suspendible() {
+		b.WriteString(" (result i32)")
+	}
+	b.WriteString("\n    unreachable)\n\n")
+	return nil
+}
+
+func (w *Backend) EmitStatement(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Node, depth uint32) error {
+	// TODO.
+	return fmt.Errorf("wasmbackend: EmitStatement not yet implemented")
+}
+
+func (w *Backend) EmitExpr(b *bytes.Buffer, pkgName string, m *t.IDMap, n *a.Expr, depth uint32) error {
+	// TODO.
+	return fmt.Errorf("wasmbackend: EmitExpr not yet implemented")
+}
+
+func (w *Backend) EmitHeaderEnd(b *bytes.Buffer, pkgName string) (bool, error) {
+	return false, nil
+}
+
+func (w *Backend) writeField(b *bytes.Buffer, m *t.IDMap, n *a.Field) error {
+	width, ok := wasmTypeWidths[n.XType().Name().Key()]
+	if !ok {
+		// TODO: fix this.
+		return fmt.Errorf("cannot convert Puffs type %q to a Wasm memory layout", n.XType().String(m))
+	}
+	fmt.Fprintf(b, "  ;;   %s: %d bytes @ %d\n", n.Name().String(m), width, w.offset)
+	w.offset += width
+	return nil
+}
+
+func (w *Backend) TypeName(m *t.IDMap, k t.Key) (string, bool) {
+	if k < t.Key(len(wasmTypeNames)) {
+		if s := wasmTypeNames[k]; s != "" {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+func (w *Backend) OpName(k t.Key) string {
+	return wasmOpNames[0xFF&k]
+}
+
+func (w *Backend) Format(rawSource *bytes.Buffer) ([]byte, error) {
+	// Closes the (module ...) opened by EmitPreamble: Generate has no
+	// epilogue hook of its own, so the closing paren is appended here,
+	// the last thing to run before the raw text leaves this package.
+	rawSource.WriteString(")\n")
+
+	// TODO: shell out to wat2wasm -validate, the way cbackend shells out
+	// to clang-format.
+	return rawSource.Bytes(), nil
+}
+
+// wasmTypeNames gives the WAT value type backing each Puffs numeric type.
+// Puffs types narrower than i32 (i8, i16, u8, u16, bool) still occupy a
+// full i32 in Wasm's stack machine; wasmTypeWidths is their memory width,
+// which can be narrower.
+var wasmTypeNames = [...]string{
+	t.KeyI8:    "i32",
+	t.KeyI16:   "i32",
+	t.KeyI32:   "i32",
+	t.KeyI64:   "i64",
+	t.KeyU8:    "i32",
+	t.KeyU16:   "i32",
+	t.KeyU32:   "i32",
+	t.KeyU64:   "i64",
+	t.KeyUsize: "i32",
+	t.KeyBool:  "i32",
+}
+
+var wasmTypeWidths = map[t.Key]uint32{
+	t.KeyI8:    1,
+	t.KeyI16:   2,
+	t.KeyI32:   4,
+	t.KeyI64:   8,
+	t.KeyU8:    1,
+	t.KeyU16:   2,
+	t.KeyU32:   4,
+	t.KeyU64:   8,
+	t.KeyUsize: 4,
+	t.KeyBool:  1,
+}
+
+var wasmOpNames = [256]string{
+	t.KeyXBinaryPlus:        "i32.add",
+	t.KeyXBinaryMinus:       "i32.sub",
+	t.KeyXBinaryStar:        "i32.mul",
+	t.KeyXBinaryAmp:         "i32.and",
+	t.KeyXBinaryPipe:        "i32.or",
+	t.KeyXBinaryHat:         "i32.xor",
+	t.KeyXBinaryNotEq:       "i32.ne",
+	t.KeyXBinaryLessThan:    "i32.lt_s",
+	t.KeyXBinaryLessEq:      "i32.le_s",
+	t.KeyXBinaryEqEq:        "i32.eq",
+	t.KeyXBinaryGreaterEq:   "i32.ge_s",
+	t.KeyXBinaryGreaterThan: "i32.gt_s",
+	t.KeyXBinaryAnd:         "i32.and",
+	t.KeyXBinaryOr:          "i32.or",
+}